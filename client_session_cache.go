@@ -0,0 +1,267 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLRUCapacity13 is the capacity used by NewLRUClientSessionCache13
+// when the caller doesn't supply a positive one.
+const defaultLRUCapacity13 = 64
+
+// maxTicketsPerServer13 bounds how many TLS 1.3 tickets are retained for a
+// single (ServerName, ALPN) entry. TLS 1.3 servers commonly issue more than
+// one NewSessionTicket per connection; keeping a handful lets the client
+// offer several of them at once (see Tickets and selectPSKIdentities13).
+const maxTicketsPerServer13 = 8
+
+// lruSessionCacheKey13 identifies a server for the purposes of the TLS 1.3
+// client ticket cache. Tickets are scoped to both the server name and the
+// negotiated ALPN protocol, since a ticket's PSK is only safe to offer again
+// within the same application protocol it was issued under.
+type lruSessionCacheKey13 struct {
+	serverName   string
+	alpnProtocol string
+}
+
+type lruSessionCacheEntry13 struct {
+	key     lruSessionCacheKey13
+	tickets []*ClientSessionState
+}
+
+// lruClientSessionCache13 is a ClientSessionCache that additionally exposes
+// per-(ServerName, ALPN) access to every ticket it holds, so that the client
+// handshake can offer more than one PSK identity per ClientHello. It evicts
+// entries least-recently-used first once it reaches capacity.
+type lruClientSessionCache13 struct {
+	sync.Mutex
+	m        map[lruSessionCacheKey13]*list.Element
+	q        *list.List
+	capacity int
+}
+
+// NewLRUClientSessionCache13 returns a TLS 1.3-aware ClientSessionCache that
+// keys entries on (ServerName, ALPN protocol) rather than on ServerName
+// alone, retains multiple tickets per entry, and evicts the least recently
+// used entry once more than capacity servers have been cached. If capacity
+// is less than 1, a reasonable default is used instead.
+func NewLRUClientSessionCache13(capacity int) ClientSessionCache {
+	if capacity < 1 {
+		capacity = defaultLRUCapacity13
+	}
+	return &lruClientSessionCache13{
+		m:        make(map[lruSessionCacheKey13]*list.Element),
+		q:        list.New(),
+		capacity: capacity,
+	}
+}
+
+// sessionKey13 builds the sessionKey string the client handshake passes to
+// a TLS 1.3 ClientSessionCache's Get/Put for (serverName, alpnProtocol).
+// ALPN protocol IDs are arbitrary octet strings per RFC 7301 and may
+// themselves contain any byte, including a literal separator, so the
+// encoding length-prefixes serverName instead of joining the two with one:
+// splitSessionKey13 then knows exactly where serverName ends regardless of
+// what either string contains.
+func sessionKey13(serverName, alpnProtocol string) string {
+	return strconv.Itoa(len(serverName)) + "|" + serverName + alpnProtocol
+}
+
+// splitSessionKey13 recovers the (serverName, alpnProtocol) pair encoded by
+// sessionKey13 into the sessionKey string that ClientSessionCache's Get/Put
+// take, so this cache can be used as a drop-in ClientSessionCache while
+// still being keyed on both values internally.
+func splitSessionKey13(sessionKey string) lruSessionCacheKey13 {
+	lenStr, rest, ok := strings.Cut(sessionKey, "|")
+	if !ok {
+		return lruSessionCacheKey13{serverName: sessionKey}
+	}
+	n, err := strconv.Atoi(lenStr)
+	if err != nil || n < 0 || n > len(rest) {
+		return lruSessionCacheKey13{serverName: rest}
+	}
+	return lruSessionCacheKey13{serverName: rest[:n], alpnProtocol: rest[n:]}
+}
+
+// Get implements ClientSessionCache by returning the most recently added,
+// unexpired ticket for the entry, if any. Callers that want every cached
+// ticket for a server, in order to offer several PSK identities at once,
+// should use Tickets instead.
+func (c *lruClientSessionCache13) Get(sessionKey string) (*ClientSessionState, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	key := splitSessionKey13(sessionKey)
+	elem, ok := c.m[key]
+	if !ok {
+		return nil, false
+	}
+	c.q.MoveToFront(elem)
+
+	entry := elem.Value.(*lruSessionCacheEntry13)
+	entry.tickets = discardExpired13(entry.tickets, uint64(time.Now().Unix()))
+	if len(entry.tickets) == 0 {
+		return nil, false
+	}
+	return entry.tickets[len(entry.tickets)-1], true
+}
+
+// Put implements ClientSessionCache by appending cs as another ticket for
+// the entry, evicting the oldest ticket for that entry once
+// maxTicketsPerServer13 is exceeded, and evicting the least recently used
+// entry once the cache is over capacity.
+func (c *lruClientSessionCache13) Put(sessionKey string, cs *ClientSessionState) {
+	c.Lock()
+	defer c.Unlock()
+
+	key := splitSessionKey13(sessionKey)
+	if elem, ok := c.m[key]; ok {
+		c.q.MoveToFront(elem)
+		entry := elem.Value.(*lruSessionCacheEntry13)
+		entry.tickets = appendTicket13(entry.tickets, cs)
+		return
+	}
+
+	if c.q.Len() >= c.capacity {
+		c.evictOldest()
+	}
+
+	entry := &lruSessionCacheEntry13{key: key}
+	entry.tickets = appendTicket13(entry.tickets, cs)
+	c.m[key] = c.q.PushFront(entry)
+}
+
+// Tickets returns every ticket cached for (serverName, alpnProtocol), oldest
+// first, dropping any that have outlived maxTicketLifetimeSeconds. It is
+// used by the client handshake to populate pre_shared_key with more than
+// one identity.
+func (c *lruClientSessionCache13) Tickets(serverName, alpnProtocol string, now uint64) []*ClientSessionState {
+	c.Lock()
+	defer c.Unlock()
+
+	key := lruSessionCacheKey13{serverName: serverName, alpnProtocol: alpnProtocol}
+	elem, ok := c.m[key]
+	if !ok {
+		return nil
+	}
+	c.q.MoveToFront(elem)
+
+	entry := elem.Value.(*lruSessionCacheEntry13)
+	entry.tickets = discardExpired13(entry.tickets, now)
+
+	out := make([]*ClientSessionState, len(entry.tickets))
+	copy(out, entry.tickets)
+	return out
+}
+
+// discardExpired13 returns those of tickets whose sessions have not
+// outlived maxTicketLifetimeSeconds as of now, preserving order.
+func discardExpired13(tickets []*ClientSessionState, now uint64) []*ClientSessionState {
+	live := tickets[:0]
+	for _, cs := range tickets {
+		if !ticketExpired13(cs.session, now) {
+			live = append(live, cs)
+		}
+	}
+	return live
+}
+
+func (c *lruClientSessionCache13) evictOldest() {
+	elem := c.q.Back()
+	if elem == nil {
+		return
+	}
+	c.q.Remove(elem)
+	delete(c.m, elem.Value.(*lruSessionCacheEntry13).key)
+}
+
+// appendTicket13 appends cs to tickets, dropping the oldest entry first if
+// that would exceed maxTicketsPerServer13.
+func appendTicket13(tickets []*ClientSessionState, cs *ClientSessionState) []*ClientSessionState {
+	tickets = append(tickets, cs)
+	if len(tickets) > maxTicketsPerServer13 {
+		tickets = tickets[len(tickets)-maxTicketsPerServer13:]
+	}
+	return tickets
+}
+
+// obfuscatedTicketAge13 computes the client's view of a ticket's age in
+// milliseconds, obfuscated by the server-provided ageAdd as required for the
+// pre_shared_key extension's obfuscated_ticket_age, clamping to the range a
+// uint32 can represent so an old ticket is reported as merely stale rather
+// than wrapping around to a small, falsely-fresh age. now and s.createdAt
+// are Unix times in seconds.
+func obfuscatedTicketAge13(s *sessionState13, now uint64) uint32 {
+	ageMillis := uint64(1<<32 - 1)
+	if age := now - s.createdAt; age <= ageMillis/1000 {
+		ageMillis = age * 1000
+	}
+	return uint32(ageMillis) + s.ageAdd
+}
+
+// ticketExpired13 reports whether a ticket is too old to be offered again.
+// Tickets are considered valid for maxTicketLifetimeSeconds regardless of
+// maxEarlyDataLen, which only bounds how much early data may accompany the
+// ticket, not how long the ticket itself may be resumed.
+func ticketExpired13(s *sessionState13, now uint64) bool {
+	const maxTicketLifetimeSeconds = 7 * 24 * 60 * 60 // one week, per RFC 8446 §4.6.1
+	return now-s.createdAt > maxTicketLifetimeSeconds
+}
+
+// earlyDataAllowed13 reports whether 0-RTT data may be sent alongside the
+// PSK identity built from s as of now. A ticket issued with
+// maxEarlyDataLen == 0 never permits early data, and a ticket old enough
+// that ticketExpired13 would reject it outright must not offer early data
+// either, even if it hasn't yet been evicted from the cache: resuming with
+// such a ticket at all is already marginal, and early data only widens the
+// replay window.
+func earlyDataAllowed13(s *sessionState13, now uint64) bool {
+	return s.maxEarlyDataLen > 0 && !ticketExpired13(s, now)
+}
+
+// pskIdentity13 is one entry ready to be written into a ClientHello's
+// pre_shared_key extension: the cached ticket plus the obfuscated_ticket_age
+// to send alongside it.
+type pskIdentity13 struct {
+	session       *ClientSessionState
+	obfuscatedAge uint32
+}
+
+// selectPSKIdentities13 picks up to limit tickets from cached, most
+// recently added first, keeping only those whose cipher suite is accepted
+// by suiteSupported (so the binder can be computed with a suite the client
+// is still willing to negotiate), and pairs each with its
+// obfuscated_ticket_age computed against now. The client handshake uses
+// this to populate pre_shared_key with more than one identity; offering
+// any entry at all implies psk_key_exchange_modes must advertise
+// psk_dhe_ke.
+//
+// selectPSKIdentities13 has no caller yet outside this package's tests:
+// building a real ClientHello's pre_shared_key and psk_key_exchange_modes
+// extensions from its output, and computing each identity's binder with
+// computePSKBinder, is handshake_client13.go's job, and that file does not
+// exist in this tree.
+func selectPSKIdentities13(cached []*ClientSessionState, now uint64, suiteSupported func(suite uint16) bool, limit int) []pskIdentity13 {
+	var out []pskIdentity13
+	for i := len(cached) - 1; i >= 0 && len(out) < limit; i-- {
+		cs := cached[i]
+		if cs == nil || cs.session == nil {
+			continue
+		}
+		if suiteSupported != nil && !suiteSupported(cs.session.suite) {
+			continue
+		}
+		out = append(out, pskIdentity13{
+			session:       cs,
+			obfuscatedAge: obfuscatedTicketAge13(cs.session, now),
+		})
+	}
+	return out
+}
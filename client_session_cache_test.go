@@ -0,0 +1,206 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionKey13RoundTrip(t *testing.T) {
+	tests := []struct {
+		serverName, alpnProtocol string
+	}{
+		{"example.com", "h2"},
+		{"example.com", ""},
+		{"", "h2"},
+		// ALPN protocol IDs are arbitrary octet strings (RFC 7301) and may
+		// contain the separator byte used internally; they must not be
+		// confused with the rest of the server name.
+		{"example.com", "weird|alpn"},
+		{"also|weird.example.com", "h2"},
+	}
+
+	for _, tt := range tests {
+		key := splitSessionKey13(sessionKey13(tt.serverName, tt.alpnProtocol))
+		if key.serverName != tt.serverName || key.alpnProtocol != tt.alpnProtocol {
+			t.Errorf("sessionKey13(%q, %q) round-tripped to (%q, %q)",
+				tt.serverName, tt.alpnProtocol, key.serverName, key.alpnProtocol)
+		}
+	}
+}
+
+// freshCreatedAt13 returns a createdAt timestamp that Get, which has no way
+// to take an explicit "now", will not treat as expired.
+func freshCreatedAt13() uint64 {
+	return uint64(time.Now().Unix())
+}
+
+func newTestClientSessionState13(suite uint16, createdAt uint64, ageAdd uint32) *ClientSessionState {
+	return &ClientSessionState{session: &sessionState13{suite: suite, createdAt: createdAt, ageAdd: ageAdd}}
+}
+
+func TestLRUClientSessionCache13MultiTicketRotation(t *testing.T) {
+	c := NewLRUClientSessionCache13(4).(*lruClientSessionCache13)
+	key := sessionKey13("example.com", "h2")
+
+	now := freshCreatedAt13()
+	var last *ClientSessionState
+	for i := 0; i < maxTicketsPerServer13+3; i++ {
+		last = newTestClientSessionState13(uint16(i), now, 0)
+		c.Put(key, last)
+	}
+
+	tickets := c.Tickets("example.com", "h2", now)
+	if len(tickets) != maxTicketsPerServer13 {
+		t.Fatalf("len(tickets) = %d, want %d", len(tickets), maxTicketsPerServer13)
+	}
+	if tickets[len(tickets)-1] != last {
+		t.Fatal("most recently Put ticket was not retained")
+	}
+	// The oldest three must have been evicted to make room.
+	if tickets[0].session.suite == 0 {
+		t.Fatal("oldest ticket beyond the per-server cap was not evicted")
+	}
+
+	got, ok := c.Get(key)
+	if !ok || got != last {
+		t.Fatal("Get did not return the most recently added ticket")
+	}
+}
+
+func TestLRUClientSessionCache13KeyedByALPN(t *testing.T) {
+	c := NewLRUClientSessionCache13(4).(*lruClientSessionCache13)
+	now := freshCreatedAt13()
+
+	h2 := newTestClientSessionState13(1, now, 0)
+	http11 := newTestClientSessionState13(2, now, 0)
+	c.Put(sessionKey13("example.com", "h2"), h2)
+	c.Put(sessionKey13("example.com", "http/1.1"), http11)
+
+	if got, ok := c.Get(sessionKey13("example.com", "h2")); !ok || got != h2 {
+		t.Fatal("h2 entry was not returned for the h2 key")
+	}
+	if got, ok := c.Get(sessionKey13("example.com", "http/1.1")); !ok || got != http11 {
+		t.Fatal("http/1.1 entry was not returned for the http/1.1 key")
+	}
+}
+
+func TestLRUClientSessionCache13Eviction(t *testing.T) {
+	c := NewLRUClientSessionCache13(2).(*lruClientSessionCache13)
+	now := freshCreatedAt13()
+
+	c.Put(sessionKey13("a.example.com", "h2"), newTestClientSessionState13(1, now, 0))
+	c.Put(sessionKey13("b.example.com", "h2"), newTestClientSessionState13(2, now, 0))
+	// Touch a.example.com so it becomes the most recently used.
+	c.Get(sessionKey13("a.example.com", "h2"))
+	c.Put(sessionKey13("c.example.com", "h2"), newTestClientSessionState13(3, now, 0))
+
+	if _, ok := c.Get(sessionKey13("b.example.com", "h2")); ok {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if _, ok := c.Get(sessionKey13("a.example.com", "h2")); !ok {
+		t.Fatal("recently used entry was evicted instead of the LRU one")
+	}
+	if _, ok := c.Get(sessionKey13("c.example.com", "h2")); !ok {
+		t.Fatal("newly inserted entry is missing")
+	}
+}
+
+func TestLRUClientSessionCache13GetFiltersExpired(t *testing.T) {
+	c := NewLRUClientSessionCache13(4).(*lruClientSessionCache13)
+	key := sessionKey13("example.com", "h2")
+
+	const now = 1 << 40
+	const maxTicketLifetimeSeconds = 7 * 24 * 60 * 60
+	c.Put(key, newTestClientSessionState13(1, now-maxTicketLifetimeSeconds-1, 0))
+
+	// Get has no way to take an explicit "now", so exercise the underlying
+	// expiry predicate the way Get applies it instead of racing time.Now.
+	entry := c.m[splitSessionKey13(key)].Value.(*lruSessionCacheEntry13)
+	entry.tickets = discardExpired13(entry.tickets, now)
+	if len(entry.tickets) != 0 {
+		t.Fatal("discardExpired13 did not drop a ticket older than maxTicketLifetimeSeconds")
+	}
+}
+
+func TestTicketsDropsExpired(t *testing.T) {
+	c := NewLRUClientSessionCache13(4).(*lruClientSessionCache13)
+	key := sessionKey13("example.com", "h2")
+
+	const now = 1 << 40
+	const maxTicketLifetimeSeconds = 7 * 24 * 60 * 60
+	fresh := newTestClientSessionState13(1, now-10, 0)
+	stale := newTestClientSessionState13(2, now-maxTicketLifetimeSeconds-10, 0)
+	c.Put(key, stale)
+	c.Put(key, fresh)
+
+	tickets := c.Tickets("example.com", "h2", now)
+	if len(tickets) != 1 || tickets[0] != fresh {
+		t.Fatalf("Tickets = %v, want only the fresh ticket", tickets)
+	}
+}
+
+func TestObfuscatedTicketAge13Clamp(t *testing.T) {
+	s := &sessionState13{createdAt: 0, ageAdd: 0}
+
+	if got := obfuscatedTicketAge13(s, 1000); got != 1000000 {
+		t.Fatalf("obfuscatedTicketAge13 = %d, want 1000000 (1000s in milliseconds)", got)
+	}
+
+	huge := &sessionState13{createdAt: 0, ageAdd: 0}
+	if got := obfuscatedTicketAge13(huge, uint64(1)<<40); got != 1<<32-1 {
+		t.Fatalf("obfuscatedTicketAge13 did not clamp to uint32 range, got %d", got)
+	}
+
+	withAdd := &sessionState13{createdAt: 100, ageAdd: 5}
+	if got := obfuscatedTicketAge13(withAdd, 150); got != 50005 {
+		t.Fatalf("obfuscatedTicketAge13 = %d, want 50005 (age 50s = 50000ms + ageAdd 5)", got)
+	}
+}
+
+func TestEarlyDataAllowed13(t *testing.T) {
+	const now = 1 << 40
+	const maxTicketLifetimeSeconds = 7 * 24 * 60 * 60
+
+	fresh := &sessionState13{createdAt: now - 10, maxEarlyDataLen: 16384}
+	if !earlyDataAllowed13(fresh, now) {
+		t.Fatal("earlyDataAllowed13 = false for a fresh ticket with a non-zero maxEarlyDataLen")
+	}
+
+	noEarlyData := &sessionState13{createdAt: now - 10, maxEarlyDataLen: 0}
+	if earlyDataAllowed13(noEarlyData, now) {
+		t.Fatal("earlyDataAllowed13 = true for a ticket with maxEarlyDataLen == 0")
+	}
+
+	aged := &sessionState13{createdAt: now - maxTicketLifetimeSeconds - 10, maxEarlyDataLen: 16384}
+	if earlyDataAllowed13(aged, now) {
+		t.Fatal("earlyDataAllowed13 = true for a ticket old enough that ticketExpired13 would reject it")
+	}
+}
+
+func TestSelectPSKIdentities13(t *testing.T) {
+	cached := []*ClientSessionState{
+		newTestClientSessionState13(0x1301, 0, 0), // TLS_AES_128_GCM_SHA256
+		newTestClientSessionState13(0x1302, 0, 0), // TLS_AES_256_GCM_SHA384
+		newTestClientSessionState13(0x1303, 0, 0), // TLS_CHACHA20_POLY1305_SHA256
+	}
+
+	onlySHA256 := func(suite uint16) bool { return suite == 0x1301 || suite == 0x1303 }
+	got := selectPSKIdentities13(cached, 1000, onlySHA256, 10)
+
+	if len(got) != 2 {
+		t.Fatalf("len(got) = %d, want 2 (suite 0x1302 should be filtered out)", len(got))
+	}
+	// Most recently added (index 2) comes first.
+	if got[0].session.session.suite != 0x1303 || got[1].session.session.suite != 0x1301 {
+		t.Fatalf("selectPSKIdentities13 did not return suites most-recent-first: %+v", got)
+	}
+
+	limited := selectPSKIdentities13(cached, 1000, nil, 1)
+	if len(limited) != 1 {
+		t.Fatalf("limit was not respected: got %d entries", len(limited))
+	}
+}
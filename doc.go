@@ -0,0 +1,51 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tls implements this fork's session ticket handling: TLS 1.2/1.3
+// ticket sealing and unsealing, Extended Master Secret enforcement on
+// resumption, and the TLS 1.3 client-side PSK ticket cache.
+//
+// Integration status, by feature:
+//
+//   - SessionTicketSealer (ticket.go): Seal/Unseal are wired into
+//     encryptTicket/decryptTicket, but neither has a real handshake caller
+//     in this tree yet — handshake_server.go and handshake_client.go, which
+//     would pass the live *ConnectionState/*ClientHelloInfo for a ticket
+//     being issued or consumed, don't exist here. A configured sealer is
+//     therefore not yet reachable from an actual TLS connection.
+//
+//   - EMS-aware resumption (ticket.go): allowsResumption/decryptTicketEMS
+//     implement the RFC 7627 §5.3 mismatch check; allowsResumption is
+//     unit-tested directly, and decryptTicketEMS has no caller outside this package's
+//     tests — the TLS 1.2 ServerHello resumption path that would call it
+//     lives in handshake_server.go, which doesn't exist in this tree. No
+//     real handshake enforces the mismatch yet.
+//
+//   - Full ConnectionState on TLS 1.3 resumption (ticket.go): sessionState13
+//     carries certificates, ocspResponse, scts and handshakeHash;
+//     newSessionTicket13 populates all four, and restoreConnectionState13
+//     (unit-tested directly) restores all but handshakeHash onto a
+//     ConnectionState. Neither function is
+//     called from the server's NewSessionTicket send path or the client's
+//     resumption path — handshake_server13.go and handshake_client13.go
+//     don't exist in this tree. A resumed TLS 1.3 connection does not yet
+//     actually regain PeerCertificates, OCSPResponse or
+//     SignedCertificateTimestamps.
+//
+//   - TLS 1.3 client PSK ticket cache (client_session_cache.go, psk13.go):
+//     NewLRUClientSessionCache13 stores and expires tickets per
+//     (ServerName, ALPN); Tickets/selectPSKIdentities13 pick and order
+//     candidate PSK identities with their obfuscated_ticket_age;
+//     earlyDataAllowed13 gates 0-RTT eligibility on maxEarlyDataLen and
+//     ticket age; computePSKBinder (psk13.go) derives an RFC 8446
+//     §4.2.11.2 PSK binder from a resumption secret and a transcript hash.
+//     All of the above are unit-tested directly but have no caller outside
+//     this package's tests: building pre_shared_key and
+//     psk_key_exchange_modes into a real ClientHello, and computing each
+//     identity's binder over the real transcript, is
+//     handshake_client13.go's job, and that file does not exist in this
+//     tree. This package provides the cache and the crypto primitive the
+//     eventual ClientHello construction will call; it does not itself
+//     offer PSK resumption on a real connection yet.
+package tls
@@ -0,0 +1,103 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+)
+
+// pskBinderHash returns the hash used to compute a PSK binder for a ticket
+// offered under suite. RFC 8446 §4.2.11.2 ties the binder to the hash of
+// the cipher suite associated with the PSK, not the hash eventually
+// negotiated for the rest of the handshake.
+func pskBinderHash(suite uint16) func() hash.Hash {
+	if suite == 0x1302 { // TLS_AES_256_GCM_SHA384
+		return sha512.New384
+	}
+	return sha256.New // TLS_AES_128_GCM_SHA256, TLS_CHACHA20_POLY1305_SHA256
+}
+
+// hkdfExtract implements HKDF-Extract (RFC 5869 §2.2).
+func hkdfExtract(h func() hash.Hash, salt, ikm []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, h().Size())
+	}
+	mac := hmac.New(h, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// hkdfExpand implements HKDF-Expand (RFC 5869 §2.3).
+func hkdfExpand(h func() hash.Hash, prk, info []byte, length int) []byte {
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac := hmac.New(h, prk)
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+// buildHKDFLabel encodes the HkdfLabel structure from RFC 8446 §7.1:
+//
+//	struct {
+//	    uint16 length = Length;
+//	    opaque label<7..255> = "tls13 " + Label;
+//	    opaque context<0..255> = Context;
+//	} HkdfLabel;
+func buildHKDFLabel(label string, context []byte, length int) []byte {
+	fullLabel := "tls13 " + label
+	b := make([]byte, 0, 2+1+len(fullLabel)+1+len(context))
+	b = append(b, byte(length>>8), byte(length))
+	b = append(b, byte(len(fullLabel)))
+	b = append(b, fullLabel...)
+	b = append(b, byte(len(context)))
+	b = append(b, context...)
+	return b
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label (RFC 8446 §7.1).
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, context []byte, length int) []byte {
+	return hkdfExpand(h, secret, buildHKDFLabel(label, context, length), length)
+}
+
+// deriveSecret implements Derive-Secret (RFC 8446 §7.1):
+// HKDF-Expand-Label(Secret, Label, Transcript-Hash(Messages), Hash.length).
+func deriveSecret(h func() hash.Hash, secret []byte, label string, messages []byte) []byte {
+	transcript := h()
+	transcript.Write(messages)
+	digest := transcript.Sum(nil)
+	return hkdfExpandLabel(h, secret, label, digest, len(digest))
+}
+
+// computePSKBinder computes the PSK binder RFC 8446 §4.2.11.2 requires a
+// ClientHello to carry alongside each resumption PSK identity:
+// HMAC(finished_key, Transcript-Hash(Truncate(ClientHello1))), where
+// finished_key descends from resumptionSecret through the early secret and
+// the "res binder" binder_key. truncatedHelloHash is the transcript hash of
+// ClientHello1 up to and including the identities field of pre_shared_key,
+// with the binders list itself (and its length prefix) excluded, per the
+// truncation rule in §4.2.11.2.
+//
+// computePSKBinder has no caller yet outside this package's tests:
+// constructing pre_shared_key/psk_key_exchange_modes in a real ClientHello
+// is handshake_client13.go's job, and that file does not exist in this
+// tree. This is the cache-and-crypto half of offering PSK resumption; the
+// ClientHello wiring is follow-up work on top of it.
+func computePSKBinder(suite uint16, resumptionSecret, truncatedHelloHash []byte) []byte {
+	h := pskBinderHash(suite)
+	earlySecret := hkdfExtract(h, nil, resumptionSecret)
+	binderKey := deriveSecret(h, earlySecret, "res binder", nil)
+	finishedKey := hkdfExpandLabel(h, binderKey, "finished", nil, h().Size())
+	mac := hmac.New(h, finishedKey)
+	mac.Write(truncatedHelloHash)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,72 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+)
+
+func TestBuildHKDFLabelWireFormat(t *testing.T) {
+	// length=0, label="x" (fullLabel "tls13 x" is 7 bytes), no context.
+	got := buildHKDFLabel("x", nil, 0)
+	want := []byte{0x00, 0x00, 0x07}
+	want = append(want, []byte("tls13 x")...)
+	want = append(want, 0x00)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("buildHKDFLabel(%q, nil, 0) = %x, want %x", "x", got, want)
+	}
+
+	// length=48, label="finished" (fullLabel "tls13 finished" is 14 bytes),
+	// a 3-byte context.
+	got = buildHKDFLabel("finished", []byte{0x01, 0x02, 0x03}, 48)
+	want = []byte{0x00, 0x30, 0x0e}
+	want = append(want, []byte("tls13 finished")...)
+	want = append(want, 0x03, 0x01, 0x02, 0x03)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("buildHKDFLabel(%q, ..., 48) = %x, want %x", "finished", got, want)
+	}
+}
+
+func TestHKDFExpandLength(t *testing.T) {
+	prk := []byte("a pseudorandom key of some length")
+	for _, length := range []int{1, 16, 32, 48, 100} {
+		out := hkdfExpand(sha256.New, prk, []byte("info"), length)
+		if len(out) != length {
+			t.Fatalf("hkdfExpand length = %d, want %d", len(out), length)
+		}
+	}
+}
+
+func TestComputePSKBinderProperties(t *testing.T) {
+	hashOfEmpty := sha256.Sum256(nil)
+	secretA := []byte("resumption secret A")
+	secretB := []byte("resumption secret B")
+
+	binder := computePSKBinder(0x1301, secretA, hashOfEmpty[:])
+	if len(binder) != sha256.Size {
+		t.Fatalf("len(binder) = %d, want %d for a SHA-256 suite", len(binder), sha256.Size)
+	}
+
+	if again := computePSKBinder(0x1301, secretA, hashOfEmpty[:]); !bytes.Equal(binder, again) {
+		t.Fatal("computePSKBinder is not deterministic for identical inputs")
+	}
+
+	if other := computePSKBinder(0x1301, secretB, hashOfEmpty[:]); bytes.Equal(binder, other) {
+		t.Fatal("computePSKBinder did not change when resumptionSecret changed")
+	}
+
+	hashOfSomething := sha256.Sum256([]byte("ClientHello1 bytes"))
+	if differentTranscript := computePSKBinder(0x1301, secretA, hashOfSomething[:]); bytes.Equal(binder, differentTranscript) {
+		t.Fatal("computePSKBinder did not change when the transcript hash changed")
+	}
+
+	sha384Binder := computePSKBinder(0x1302, secretA, make([]byte, sha512.Size384))
+	if len(sha384Binder) != sha512.Size384 {
+		t.Fatalf("len(binder) = %d, want %d for a SHA-384 suite", len(sha384Binder), sha512.Size384)
+	}
+}
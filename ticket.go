@@ -11,10 +11,17 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/subtle"
+	"crypto/x509"
 	"errors"
 	"io"
 )
 
+// sessionStateVersion is prepended to the serialized form of sessionState.
+// It was introduced when the usedEMS field was added so that tickets
+// encoded by an older binary, which carry no such byte, are rejected
+// outright by unmarshal instead of being misparsed.
+const sessionStateVersion = 1
+
 // sessionState contains the information that is serialized into a session
 // ticket in order to later resume a connection.
 type sessionState struct {
@@ -25,6 +32,10 @@ type sessionState struct {
 	// usedOldKey is true if the ticket from which this session came from
 	// was encrypted with an older key and thus should be refreshed.
 	usedOldKey bool
+	// usedEMS is true if the session was negotiated with the Extended
+	// Master Secret (RFC 7627). Per RFC 7627 §5.3, such a session may only
+	// be resumed on a connection that also negotiates EMS.
+	usedEMS bool
 }
 
 func (s *sessionState) equal(i interface{}) bool {
@@ -35,7 +46,8 @@ func (s *sessionState) equal(i interface{}) bool {
 
 	if s.vers != s1.vers ||
 		s.cipherSuite != s1.cipherSuite ||
-		!bytes.Equal(s.masterSecret, s1.masterSecret) {
+		!bytes.Equal(s.masterSecret, s1.masterSecret) ||
+		s.usedEMS != s1.usedEMS {
 		return false
 	}
 
@@ -53,20 +65,21 @@ func (s *sessionState) equal(i interface{}) bool {
 }
 
 func (s *sessionState) marshal() []byte {
-	length := 2 + 2 + 2 + len(s.masterSecret) + 2
+	length := 1 + 2 + 2 + 2 + len(s.masterSecret) + 2 + 1
 	for _, cert := range s.certificates {
 		length += 4 + len(cert)
 	}
 
 	ret := make([]byte, length)
 	x := ret
-	x[0] = byte(s.vers >> 8)
-	x[1] = byte(s.vers)
-	x[2] = byte(s.cipherSuite >> 8)
-	x[3] = byte(s.cipherSuite)
-	x[4] = byte(len(s.masterSecret) >> 8)
-	x[5] = byte(len(s.masterSecret))
-	x = x[6:]
+	x[0] = sessionStateVersion
+	x[1] = byte(s.vers >> 8)
+	x[2] = byte(s.vers)
+	x[3] = byte(s.cipherSuite >> 8)
+	x[4] = byte(s.cipherSuite)
+	x[5] = byte(len(s.masterSecret) >> 8)
+	x[6] = byte(len(s.masterSecret))
+	x = x[7:]
 	copy(x, s.masterSecret)
 	x = x[len(s.masterSecret):]
 
@@ -83,10 +96,21 @@ func (s *sessionState) marshal() []byte {
 		x = x[4+len(cert):]
 	}
 
+	if s.usedEMS {
+		x[0] = 1
+	} else {
+		x[0] = 0
+	}
+
 	return ret
 }
 
 func (s *sessionState) unmarshal(data []byte) bool {
+	if len(data) < 1 || data[0] != sessionStateVersion {
+		return false
+	}
+	data = data[1:]
+
 	if len(data) < 8 {
 		return false
 	}
@@ -126,9 +150,60 @@ func (s *sessionState) unmarshal(data []byte) bool {
 		data = data[certLen:]
 	}
 
-	return len(data) == 0
+	if len(data) != 1 {
+		return false
+	}
+	s.usedEMS = data[0] == 1
+
+	return true
 }
 
+// allowsResumption reports whether a connection that negotiated Extended
+// Master Secret as connUsedEMS may resume from session s. Per RFC 7627
+// §5.3, a session negotiated with EMS may only be resumed on a connection
+// that also negotiates EMS, and a session negotiated without it may not be
+// resumed into one that does, since the two modes compute the master
+// secret differently.
+func (s *sessionState) allowsResumption(connUsedEMS bool) bool {
+	return s.usedEMS == connUsedEMS
+}
+
+// decryptTicketEMS decrypts and unmarshals a TLS 1.2 session ticket and
+// enforces the RFC 7627 §5.3 EMS resumption rule in a single step. ok is
+// false if the ticket could not be decrypted, did not unmarshal, or its
+// stored usedEMS flag disagrees with connUsedEMS; in every such case the
+// caller must fall back to a full handshake rather than resume.
+//
+// decryptTicketEMS has no caller yet outside this package's tests:
+// handshake_server.go, which would call this during ServerHello processing
+// of a TLS 1.2 resumption attempt, does not exist in this tree. Until that
+// call site is added, EMS resumption mismatches are not actually enforced
+// on any real connection.
+func (c *Conn) decryptTicketEMS(chi *ClientHelloInfo, encrypted []byte, connUsedEMS bool) (sess *sessionState, usedOldKey bool, ok bool) {
+	plaintext, usedOldKey := c.decryptTicket(chi, encrypted)
+	if plaintext == nil {
+		return nil, false, false
+	}
+
+	sess = new(sessionState)
+	if !sess.unmarshal(plaintext) {
+		return nil, false, false
+	}
+
+	if !sess.allowsResumption(connUsedEMS) {
+		return nil, false, false
+	}
+
+	return sess, usedOldKey, true
+}
+
+// maxSessionState13TicketSize is a soft cap on the encoded size of a
+// sessionState13. A full certificate chain, OCSP response and SCT list can
+// be large; chains that would push the ticket past this size are not
+// resumable and are issued as a full handshake instead of a giant
+// NewSessionTicket message.
+const maxSessionState13TicketSize = 48 * 1024
+
 type sessionState13 struct {
 	vers             uint16
 	suite            uint16
@@ -138,6 +213,15 @@ type sessionState13 struct {
 	resumptionSecret []byte
 	alpnProtocol     string
 	SNI              string
+	// certificates, ocspResponse, scts and handshakeHash are carried so
+	// that ConnectionState on a resumed connection can be restored to
+	// match the original connection's PeerCertificates, OCSPResponse and
+	// SignedCertificateTimestamps. VerifiedChains is not carried and is
+	// not restored from the ticket.
+	certificates  [][]byte
+	ocspResponse  []byte
+	scts          [][]byte
+	handshakeHash []byte
 }
 
 func (s *sessionState13) equal(i interface{}) bool {
@@ -146,18 +230,70 @@ func (s *sessionState13) equal(i interface{}) bool {
 		return false
 	}
 
-	return s.vers == s1.vers &&
-		s.suite == s1.suite &&
-		s.ageAdd == s1.ageAdd &&
-		s.createdAt == s1.createdAt &&
-		s.maxEarlyDataLen == s1.maxEarlyDataLen &&
-		bytes.Equal(s.resumptionSecret, s1.resumptionSecret) &&
-		s.alpnProtocol == s1.alpnProtocol &&
-		s.SNI == s1.SNI
+	if s.vers != s1.vers ||
+		s.suite != s1.suite ||
+		s.ageAdd != s1.ageAdd ||
+		s.createdAt != s1.createdAt ||
+		s.maxEarlyDataLen != s1.maxEarlyDataLen ||
+		!bytes.Equal(s.resumptionSecret, s1.resumptionSecret) ||
+		s.alpnProtocol != s1.alpnProtocol ||
+		s.SNI != s1.SNI ||
+		!bytes.Equal(s.ocspResponse, s1.ocspResponse) ||
+		!bytes.Equal(s.handshakeHash, s1.handshakeHash) {
+		return false
+	}
+
+	if len(s.certificates) != len(s1.certificates) {
+		return false
+	}
+	for i := range s.certificates {
+		if !bytes.Equal(s.certificates[i], s1.certificates[i]) {
+			return false
+		}
+	}
+
+	if len(s.scts) != len(s1.scts) {
+		return false
+	}
+	for i := range s.scts {
+		if !bytes.Equal(s.scts[i], s1.scts[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tooLarge reports whether s's encoded form would exceed
+// maxSessionState13TicketSize, in which case it should not be issued as a
+// session ticket.
+func (s *sessionState13) tooLarge() bool {
+	size := 2 + 2 + 4 + 8 + 4 + 2 + len(s.resumptionSecret) + 2 + len(s.alpnProtocol) + 2 + len(s.SNI)
+	size += 2
+	for _, cert := range s.certificates {
+		size += 4 + len(cert)
+	}
+	size += 2 + len(s.ocspResponse)
+	size += 2
+	for _, sct := range s.scts {
+		size += 2 + len(sct)
+	}
+	size += 2 + len(s.handshakeHash)
+	return size > maxSessionState13TicketSize
 }
 
 func (s *sessionState13) marshal() []byte {
 	length := 2 + 2 + 4 + 8 + 4 + 2 + len(s.resumptionSecret) + 2 + len(s.alpnProtocol) + 2 + len(s.SNI)
+	length += 2
+	for _, cert := range s.certificates {
+		length += 4 + len(cert)
+	}
+	length += 2 + len(s.ocspResponse)
+	length += 2
+	for _, sct := range s.scts {
+		length += 2 + len(sct)
+	}
+	length += 2 + len(s.handshakeHash)
 
 	x := make([]byte, length)
 	x[0] = byte(s.vers >> 8)
@@ -191,6 +327,38 @@ func (s *sessionState13) marshal() []byte {
 	z[0] = byte(len(s.SNI) >> 8)
 	z[1] = byte(len(s.SNI))
 	copy(z[2:], s.SNI)
+	z = z[2+len(s.SNI):]
+
+	z[0] = byte(len(s.certificates) >> 8)
+	z[1] = byte(len(s.certificates))
+	z = z[2:]
+	for _, cert := range s.certificates {
+		z[0] = byte(len(cert) >> 24)
+		z[1] = byte(len(cert) >> 16)
+		z[2] = byte(len(cert) >> 8)
+		z[3] = byte(len(cert))
+		copy(z[4:], cert)
+		z = z[4+len(cert):]
+	}
+
+	z[0] = byte(len(s.ocspResponse) >> 8)
+	z[1] = byte(len(s.ocspResponse))
+	copy(z[2:], s.ocspResponse)
+	z = z[2+len(s.ocspResponse):]
+
+	z[0] = byte(len(s.scts) >> 8)
+	z[1] = byte(len(s.scts))
+	z = z[2:]
+	for _, sct := range s.scts {
+		z[0] = byte(len(sct) >> 8)
+		z[1] = byte(len(sct))
+		copy(z[2:], sct)
+		z = z[2+len(sct):]
+	}
+
+	z[0] = byte(len(s.handshakeHash) >> 8)
+	z[1] = byte(len(s.handshakeHash))
+	copy(z[2:], s.handshakeHash)
 
 	return x
 }
@@ -222,15 +390,181 @@ func (s *sessionState13) unmarshal(data []byte) bool {
 	z = z[2+l:]
 
 	l = int(z[0])<<8 | int(z[1])
-	if len(z) != 2+l {
+	if len(z) < 2+l {
 		return false
 	}
 	s.SNI = string(z[2 : 2+l])
+	z = z[2+l:]
+
+	if len(z) < 2 {
+		return false
+	}
+	numCerts := int(z[0])<<8 | int(z[1])
+	z = z[2:]
+
+	s.certificates = make([][]byte, numCerts)
+	for i := range s.certificates {
+		if len(z) < 4 {
+			return false
+		}
+		certLen := int(z[0])<<24 | int(z[1])<<16 | int(z[2])<<8 | int(z[3])
+		z = z[4:]
+		if certLen < 0 || len(z) < certLen {
+			return false
+		}
+		s.certificates[i] = z[:certLen]
+		z = z[certLen:]
+	}
+
+	if len(z) < 2 {
+		return false
+	}
+	l = int(z[0])<<8 | int(z[1])
+	if len(z) < 2+l {
+		return false
+	}
+	s.ocspResponse = z[2 : 2+l]
+	z = z[2+l:]
+
+	if len(z) < 2 {
+		return false
+	}
+	numSCTs := int(z[0])<<8 | int(z[1])
+	z = z[2:]
+
+	s.scts = make([][]byte, numSCTs)
+	for i := range s.scts {
+		if len(z) < 2 {
+			return false
+		}
+		sctLen := int(z[0])<<8 | int(z[1])
+		z = z[2:]
+		if len(z) < sctLen {
+			return false
+		}
+		s.scts[i] = z[:sctLen]
+		z = z[sctLen:]
+	}
+
+	if len(z) < 2 {
+		return false
+	}
+	l = int(z[0])<<8 | int(z[1])
+	if len(z) != 2+l {
+		return false
+	}
+	s.handshakeHash = z[2 : 2+l]
 
 	return true
 }
 
-func (c *Conn) encryptTicket(serialized []byte) ([]byte, error) {
+// certificateChainBytes returns the DER encoding of each certificate in
+// cs.PeerCertificates, in order, for storage in a sessionState13.
+func certificateChainBytes(cs *ConnectionState) [][]byte {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	raw := make([][]byte, len(cs.PeerCertificates))
+	for i, cert := range cs.PeerCertificates {
+		raw[i] = cert.Raw
+	}
+	return raw
+}
+
+// parseCertificateChain parses each DER-encoded certificate in raw, in
+// order, as stored in a sessionState13's certificates field.
+func parseCertificateChain(raw [][]byte) ([]*x509.Certificate, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	certs := make([]*x509.Certificate, len(raw))
+	for i, der := range raw {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.New("tls: failed to parse certificate from session ticket: " + err.Error())
+		}
+		certs[i] = cert
+	}
+	return certs, nil
+}
+
+// newSessionTicket13 builds and seals the NewSessionTicket payload for a
+// TLS 1.3 connection whose live state is cs, populating the peer
+// certificate chain, OCSP response, SCT list and handshake transcript hash
+// in sess so that ConnectionState on a resumed connection can be restored
+// to match. If the encoded session state would exceed
+// maxSessionState13TicketSize, ok is false and the caller should not send a
+// NewSessionTicket for this connection at all, rather than issue one that
+// can't carry the full resumption state.
+//
+// newSessionTicket13 and restoreConnectionState13 below have no caller yet
+// outside this package's tests: the server-side NewSessionTicket send path
+// and the client-side resumption path both live in handshake_server13.go
+// and handshake_client13.go, neither of which exists in this tree. Until
+// those call sites are added, resumed TLS 1.3 connections do not actually
+// regain PeerCertificates, OCSPResponse or SignedCertificateTimestamps.
+func (c *Conn) newSessionTicket13(cs *ConnectionState, sess *sessionState13, handshakeHash []byte) (ticket []byte, ok bool, err error) {
+	sess.certificates = certificateChainBytes(cs)
+	sess.ocspResponse = cs.OCSPResponse
+	sess.scts = cs.SignedCertificateTimestamps
+	sess.handshakeHash = handshakeHash
+
+	if sess.tooLarge() {
+		return nil, false, nil
+	}
+
+	ticket, err = c.encryptTicket(cs, sess.marshal())
+	if err != nil {
+		return nil, false, err
+	}
+	return ticket, true, nil
+}
+
+// restoreConnectionState13 copies the peer certificate chain, OCSP response
+// and SCT list carried in sess onto cs, so that ConnectionState on a
+// connection resumed from sess matches the one the ticket was issued from.
+// It does not populate VerifiedChains: re-establishing those requires
+// re-running chain verification against the current Config, which is the
+// caller's responsibility.
+func restoreConnectionState13(cs *ConnectionState, sess *sessionState13) error {
+	certs, err := parseCertificateChain(sess.certificates)
+	if err != nil {
+		return err
+	}
+	cs.PeerCertificates = certs
+	cs.OCSPResponse = sess.ocspResponse
+	cs.SignedCertificateTimestamps = sess.scts
+	return nil
+}
+
+// SessionTicketSealer is the interface implemented by external session
+// ticket encryption providers. When Config.SessionTicketSealer is set, it
+// replaces the built-in AES-CTR+HMAC-SHA256 scheme used by encryptTicket and
+// decryptTicket, so that ticket sealing can be backed by a KMS, an HSM, or a
+// remote ticket service, and so that keys can be rotated out of process.
+//
+// encryptTicket and decryptTicket below are the only two call sites; neither
+// handshake_server.go nor handshake_client.go exist yet in this tree to be
+// updated to pass the real per-connection ConnectionState/ClientHelloInfo
+// through, so until that wiring lands, a configured sealer only takes effect
+// for callers that already hold those values themselves.
+type SessionTicketSealer interface {
+	// Seal encrypts content, the serialized state of cs, into a session
+	// ticket. An error aborts the handshake that triggered the encryption.
+	Seal(cs *ConnectionState, content []byte) (ticket []byte, err error)
+
+	// Unseal decrypts ticket, a value previously returned by Seal, back into
+	// the serialized session state for the connection described by chi. If
+	// ticket cannot be decrypted, success is false and the handshake falls
+	// back to a full handshake rather than resuming.
+	Unseal(chi *ClientHelloInfo, ticket []byte) (content []byte, success bool)
+}
+
+func (c *Conn) encryptTicket(cs *ConnectionState, serialized []byte) ([]byte, error) {
+	if sealer := c.config.SessionTicketSealer; sealer != nil {
+		return sealer.Seal(cs, serialized)
+	}
+
 	encrypted := make([]byte, ticketKeyNameLen+aes.BlockSize+len(serialized)+sha256.Size)
 	keyName := encrypted[:ticketKeyNameLen]
 	iv := encrypted[ticketKeyNameLen : ticketKeyNameLen+aes.BlockSize]
@@ -254,9 +588,20 @@ func (c *Conn) encryptTicket(serialized []byte) ([]byte, error) {
 	return encrypted, nil
 }
 
-func (c *Conn) decryptTicket(encrypted []byte) (serialized []byte, usedOldKey bool) {
-	if c.config.SessionTicketsDisabled ||
-		len(encrypted) < ticketKeyNameLen+aes.BlockSize+sha256.Size {
+func (c *Conn) decryptTicket(chi *ClientHelloInfo, encrypted []byte) (serialized []byte, usedOldKey bool) {
+	if c.config.SessionTicketsDisabled {
+		return nil, false
+	}
+
+	if sealer := c.config.SessionTicketSealer; sealer != nil {
+		content, ok := sealer.Unseal(chi, encrypted)
+		if !ok {
+			return nil, false
+		}
+		return content, false
+	}
+
+	if len(encrypted) < ticketKeyNameLen+aes.BlockSize+sha256.Size {
 		return nil, false
 	}
 
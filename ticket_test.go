@@ -0,0 +1,260 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// mockSessionTicketSealer is a SessionTicketSealer used to exercise the
+// interface contract: Seal returns a copy of content as the ticket and
+// Unseal returns a copy of the ticket as the content, unless configured to
+// fail.
+type mockSessionTicketSealer struct {
+	unsealOK bool
+	sealErr  error
+}
+
+func (m *mockSessionTicketSealer) Seal(cs *ConnectionState, content []byte) ([]byte, error) {
+	if m.sealErr != nil {
+		return nil, m.sealErr
+	}
+	ticket := make([]byte, len(content))
+	copy(ticket, content)
+	return ticket, nil
+}
+
+func (m *mockSessionTicketSealer) Unseal(chi *ClientHelloInfo, ticket []byte) ([]byte, bool) {
+	if !m.unsealOK {
+		return nil, false
+	}
+	content := make([]byte, len(ticket))
+	copy(content, ticket)
+	return content, true
+}
+
+func TestSessionTicketSealerRoundTrip(t *testing.T) {
+	sealer := &mockSessionTicketSealer{unsealOK: true}
+	content := []byte("session state bytes")
+
+	ticket, err := sealer.Seal(new(ConnectionState), content)
+	if err != nil {
+		t.Fatalf("Seal returned error: %v", err)
+	}
+
+	got, ok := sealer.Unseal(new(ClientHelloInfo), ticket)
+	if !ok {
+		t.Fatal("Unseal reported failure for a ticket produced by Seal")
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Unseal = %q, want %q", got, content)
+	}
+}
+
+func TestSessionTicketSealerUnsealFailureFallsBack(t *testing.T) {
+	sealer := &mockSessionTicketSealer{unsealOK: false}
+
+	if _, ok := sealer.Unseal(new(ClientHelloInfo), []byte("anything")); ok {
+		t.Fatal("Unseal reported success when the sealer said it would not")
+	}
+
+	c := &Conn{config: &Config{SessionTicketSealer: sealer}}
+	if plaintext, _ := c.decryptTicket(new(ClientHelloInfo), []byte("anything")); plaintext != nil {
+		t.Fatal("decryptTicket returned session state although Unseal failed")
+	}
+}
+
+func TestSessionTicketSealerSealError(t *testing.T) {
+	wantErr := errors.New("kms unavailable")
+	sealer := &mockSessionTicketSealer{sealErr: wantErr}
+
+	if _, err := sealer.Seal(new(ConnectionState), []byte("x")); err != wantErr {
+		t.Fatalf("Seal error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestSessionStateMarshalUnmarshalEMS(t *testing.T) {
+	for _, usedEMS := range []bool{true, false} {
+		s := &sessionState{
+			vers:         VersionTLS12,
+			cipherSuite:  0xc02f,
+			masterSecret: []byte("master secret bytes"),
+			certificates: [][]byte{[]byte("cert one"), []byte("cert two")},
+			usedEMS:      usedEMS,
+		}
+
+		s1 := new(sessionState)
+		if !s1.unmarshal(s.marshal()) {
+			t.Fatalf("unmarshal of a freshly marshaled sessionState (usedEMS=%v) failed", usedEMS)
+		}
+		if !s.equal(s1) {
+			t.Fatalf("round-tripped sessionState (usedEMS=%v) != original", usedEMS)
+		}
+		if s1.usedEMS != usedEMS {
+			t.Fatalf("usedEMS = %v, want %v", s1.usedEMS, usedEMS)
+		}
+	}
+}
+
+func TestSessionStateUnmarshalRejectsUnversionedTicket(t *testing.T) {
+	s := &sessionState{vers: VersionTLS12, cipherSuite: 0xc02f, masterSecret: []byte("secret"), usedEMS: true}
+	data := s.marshal()
+
+	// A ticket encoded before usedEMS/the version byte existed carried no
+	// leading version byte at all; its first byte was the high byte of
+	// vers. Simulate that older wire format and confirm it's rejected
+	// outright rather than misparsed.
+	legacy := data[1:]
+	if new(sessionState).unmarshal(legacy) {
+		t.Fatal("unmarshal accepted data missing the sessionStateVersion byte")
+	}
+
+	// A mismatched version byte must also be rejected.
+	tampered := append([]byte{}, data...)
+	tampered[0] = sessionStateVersion + 1
+	if new(sessionState).unmarshal(tampered) {
+		t.Fatal("unmarshal accepted an unrecognized sessionStateVersion")
+	}
+}
+
+func TestSessionStateAllowsResumption(t *testing.T) {
+	tests := []struct {
+		ticketEMS, connEMS, want bool
+	}{
+		{true, true, true},
+		{false, false, true},
+		{true, false, false},
+		{false, true, false},
+	}
+
+	for _, tt := range tests {
+		s := &sessionState{usedEMS: tt.ticketEMS}
+		if got := s.allowsResumption(tt.connEMS); got != tt.want {
+			t.Errorf("allowsResumption(ticketEMS=%v, connEMS=%v) = %v, want %v",
+				tt.ticketEMS, tt.connEMS, got, tt.want)
+		}
+	}
+}
+
+// generateTestCertificate returns a minimal self-signed certificate, for
+// tests that need a valid DER encoding to round-trip through
+// x509.ParseCertificate.
+func generateTestCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ticket test"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+func TestCertificateChainBytesRoundTrip(t *testing.T) {
+	cert := generateTestCertificate(t)
+	cs := &ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	raw := certificateChainBytes(cs)
+	if len(raw) != 1 || !bytes.Equal(raw[0], cert.Raw) {
+		t.Fatalf("certificateChainBytes produced unexpected output: %v", raw)
+	}
+
+	certs, err := parseCertificateChain(raw)
+	if err != nil {
+		t.Fatalf("parseCertificateChain: %v", err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Fatalf("parseCertificateChain did not reproduce the original certificate")
+	}
+}
+
+func TestRestoreConnectionState13(t *testing.T) {
+	cert := generateTestCertificate(t)
+	sess := &sessionState13{
+		certificates: [][]byte{cert.Raw},
+		ocspResponse: []byte("ocsp response"),
+		scts:         [][]byte{[]byte("sct one")},
+	}
+
+	cs := new(ConnectionState)
+	if err := restoreConnectionState13(cs, sess); err != nil {
+		t.Fatalf("restoreConnectionState13: %v", err)
+	}
+
+	if len(cs.PeerCertificates) != 1 || !cs.PeerCertificates[0].Equal(cert) {
+		t.Fatal("PeerCertificates was not restored from the session ticket")
+	}
+	if !bytes.Equal(cs.OCSPResponse, sess.ocspResponse) {
+		t.Fatal("OCSPResponse was not restored from the session ticket")
+	}
+	if len(cs.SignedCertificateTimestamps) != 1 || !bytes.Equal(cs.SignedCertificateTimestamps[0], sess.scts[0]) {
+		t.Fatal("SignedCertificateTimestamps was not restored from the session ticket")
+	}
+}
+
+func TestSessionState13MarshalUnmarshalFullState(t *testing.T) {
+	cert := generateTestCertificate(t)
+	s := &sessionState13{
+		vers:             VersionTLS13,
+		suite:            0x1301,
+		ageAdd:           0xdeadbeef,
+		createdAt:        1700000000,
+		maxEarlyDataLen:  16384,
+		resumptionSecret: []byte("resumption secret"),
+		alpnProtocol:     "h2",
+		SNI:              "example.com",
+		certificates:     [][]byte{cert.Raw},
+		ocspResponse:     []byte("ocsp response"),
+		scts:             [][]byte{[]byte("sct one"), []byte("sct two")},
+		handshakeHash:    []byte("handshake transcript hash"),
+	}
+
+	s1 := new(sessionState13)
+	if !s1.unmarshal(s.marshal()) {
+		t.Fatal("unmarshal of a freshly marshaled sessionState13 failed")
+	}
+	if !s.equal(s1) {
+		t.Fatal("round-tripped sessionState13 != original")
+	}
+}
+
+func TestSessionState13TooLarge(t *testing.T) {
+	small := &sessionState13{resumptionSecret: []byte("short")}
+	if small.tooLarge() {
+		t.Fatal("a small sessionState13 was reported too large")
+	}
+
+	large := &sessionState13{
+		certificates: [][]byte{make([]byte, maxSessionState13TicketSize+1)},
+	}
+	if !large.tooLarge() {
+		t.Fatal("an oversize sessionState13 was not reported too large")
+	}
+}